@@ -0,0 +1,348 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var _ DB = (*CacheDB)(nil)
+
+// cValue is a buffered write in a CacheDB. deleted distinguishes a
+// tombstone (pending delete) from a zero-length value, since CacheDB's
+// own Get/Iterator must hide keys that are pending deletion even though
+// the parent DB still has them.
+type cValue struct {
+	value   []byte
+	deleted bool
+}
+
+// CacheDB wraps an underlying DB and buffers Set/Delete calls in memory
+// until Write() is called, the way an SDK-style cache-KV store sits in
+// front of the real backing store. It gives callers a reusable
+// transactional layer on top of MemDB, LevelDB, etc., instead of every
+// consumer reinventing one.
+type CacheDB struct {
+	mtx    sync.Mutex
+	parent DB
+	cache  map[string]*cValue
+}
+
+func NewCacheDB(parent DB) *CacheDB {
+	return &CacheDB{
+		parent: parent,
+		cache:  make(map[string]*cValue),
+	}
+}
+
+func (c *CacheDB) Get(key []byte) []byte {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	key = nonNilBytes(key)
+
+	if v, ok := c.cache[string(key)]; ok {
+		if v.deleted {
+			return nil
+		}
+		return v.value
+	}
+	return c.parent.Get(key)
+}
+
+func (c *CacheDB) Has(key []byte) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	key = nonNilBytes(key)
+
+	if v, ok := c.cache[string(key)]; ok {
+		return !v.deleted
+	}
+	return c.parent.Has(key)
+}
+
+func (c *CacheDB) Set(key, value []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.SetNoLock(key, value)
+}
+
+func (c *CacheDB) SetSync(key, value []byte) {
+	c.Set(key, value)
+}
+
+// NOTE: Implements atomicSetDeleter
+func (c *CacheDB) SetNoLock(key, value []byte) {
+	key = nonNilBytes(key)
+	value = nonNilBytes(value)
+
+	c.cache[string(key)] = &cValue{value: value}
+}
+
+func (c *CacheDB) Delete(key []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.DeleteNoLock(key)
+}
+
+func (c *CacheDB) DeleteSync(key []byte) {
+	c.Delete(key)
+}
+
+// NOTE: Implements atomicSetDeleter
+func (c *CacheDB) DeleteNoLock(key []byte) {
+	key = nonNilBytes(key)
+
+	c.cache[string(key)] = &cValue{deleted: true}
+}
+
+// Close is a no-op. CacheDB is meant to be used as a short-lived wrapper
+// over a long-lived parent store (one per block/tx: Write() or
+// Discard(), then dispose) — it does not own the parent's lifecycle, so
+// closing one wrapper must not tear down the shared parent DB out from
+// under every other CacheDB layered over it.
+func (c *CacheDB) Close() {
+}
+
+func (c *CacheDB) Print() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	itr := c.iteratorNoLock(nil, nil, false)
+	defer itr.Close()
+	for ; itr.Valid(); itr.Next() {
+		fmt.Printf("[%X]:\t[%X]\n", itr.Key(), itr.Value())
+	}
+}
+
+func (c *CacheDB) Stats() map[string]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	stats := make(map[string]string)
+	stats["database.type"] = "cacheDB"
+	stats["database.dirty"] = fmt.Sprintf("%d", len(c.cache))
+	return stats
+}
+
+func (c *CacheDB) NewBatch() Batch {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return &memBatch{c, nil}
+}
+
+func (c *CacheDB) Mutex() *sync.Mutex {
+	return &(c.mtx)
+}
+
+// Write flushes all buffered sets and deletes to the parent DB in a
+// single atomic batch, then clears the cache.
+func (c *CacheDB) Write() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	batch := c.parent.NewBatch()
+	for key, v := range c.cache {
+		if v.deleted {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Set([]byte(key), v.value)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		// The flush never reached the parent; leave the cache intact so
+		// the caller can retry instead of silently losing the buffered
+		// writes.
+		return err
+	}
+
+	c.cache = make(map[string]*cValue)
+	return nil
+}
+
+// Discard drops all buffered sets and deletes without touching the
+// parent DB.
+func (c *CacheDB) Discard() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.cache = make(map[string]*cValue)
+}
+
+//----------------------------------------
+
+func (c *CacheDB) Iterator(start, end []byte) Iterator {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.iteratorNoLock(start, end, false)
+}
+
+func (c *CacheDB) ReverseIterator(start, end []byte) Iterator {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.iteratorNoLock(start, end, true)
+}
+
+func (c *CacheDB) iteratorNoLock(start, end []byte, reverse bool) Iterator {
+	var parent Iterator
+	if reverse {
+		parent = c.parent.ReverseIterator(start, end)
+	} else {
+		parent = c.parent.Iterator(start, end)
+	}
+
+	// Copy the selected entries out of c.cache rather than handing the
+	// iterator the live map: the iterator outlives this call (and the
+	// c.mtx critical section it runs in), while c.cache keeps being
+	// mutated by concurrent Set/Delete calls. Aliasing it would let the
+	// iterator's unsynchronized reads race with those writes.
+	keys := make([]string, 0, len(c.cache))
+	cache := make(map[string]*cValue, len(c.cache))
+	for key, v := range c.cache {
+		if IsKeyInDomain([]byte(key), start, end, false) {
+			keys = append(keys, key)
+			cache[key] = &cValue{value: v.value, deleted: v.deleted}
+		}
+	}
+	sort.Strings(keys)
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	return newCacheMergeIterator(parent, keys, cache, start, end, reverse)
+}
+
+var _ Iterator = (*cacheMergeIterator)(nil)
+
+// cacheMergeIterator walks the parent's Iterator/ReverseIterator
+// alongside the CacheDB's own dirty keys (already sorted into the same
+// order by iteratorNoLock), honoring the same ascending/descending
+// domain rules as MemDB.Iterator: whichever source has the
+// lexicographically-first (or, in reverse, -last) key wins; on a tie the
+// cache shadows the parent; a tombstone hides the key entirely.
+type cacheMergeIterator struct {
+	parent    Iterator
+	cacheKeys []string
+	cache     map[string]*cValue
+	cur       int
+	reverse   bool
+	start     []byte
+	end       []byte
+}
+
+func newCacheMergeIterator(parent Iterator, cacheKeys []string, cache map[string]*cValue, start, end []byte, reverse bool) *cacheMergeIterator {
+	itr := &cacheMergeIterator{
+		parent:    parent,
+		cacheKeys: cacheKeys,
+		cache:     cache,
+		cur:       0,
+		reverse:   reverse,
+		start:     start,
+		end:       end,
+	}
+	itr.skipDeleted()
+	return itr
+}
+
+func (itr *cacheMergeIterator) cacheDone() bool {
+	return itr.cur >= len(itr.cacheKeys)
+}
+
+// cacheBeforeParent reports whether the pending cache key should be
+// surfaced ahead of the parent's current key, under itr.reverse.
+func (itr *cacheMergeIterator) cacheBeforeParent() bool {
+	if itr.cacheDone() {
+		return false
+	}
+	if !itr.parent.Valid() {
+		return true
+	}
+	cmp := bytes.Compare([]byte(itr.cacheKeys[itr.cur]), itr.parent.Key())
+	if itr.reverse {
+		return cmp >= 0
+	}
+	return cmp <= 0
+}
+
+// skipDeleted advances past tombstoned cache entries (and the parent
+// entry they shadow, if any) until the merge head sits on a live key.
+// It only consumes a tombstone once it is actually the merge head
+// (cacheBeforeParent), the same test Next()/Key()/Value() use — a
+// tombstone further ahead in cacheKeys must stay put until the parent
+// iterator reaches that position, or it would be "applied" before its
+// turn and never shadow the parent's matching entry.
+func (itr *cacheMergeIterator) skipDeleted() {
+	for !itr.cacheDone() {
+		key := itr.cacheKeys[itr.cur]
+		if !itr.cache[key].deleted {
+			return
+		}
+		if !itr.cacheBeforeParent() {
+			return
+		}
+		if itr.parent.Valid() && bytes.Equal(itr.parent.Key(), []byte(key)) {
+			itr.parent.Next()
+		}
+		itr.cur++
+	}
+}
+
+func (itr *cacheMergeIterator) Domain() ([]byte, []byte) {
+	return itr.start, itr.end
+}
+
+func (itr *cacheMergeIterator) Valid() bool {
+	return !itr.cacheDone() || itr.parent.Valid()
+}
+
+func (itr *cacheMergeIterator) Next() {
+	itr.assertIsValid()
+
+	if itr.cacheBeforeParent() {
+		key := itr.cacheKeys[itr.cur]
+		if itr.parent.Valid() && bytes.Equal(itr.parent.Key(), []byte(key)) {
+			itr.parent.Next()
+		}
+		itr.cur++
+	} else {
+		itr.parent.Next()
+	}
+	itr.skipDeleted()
+}
+
+func (itr *cacheMergeIterator) Key() []byte {
+	itr.assertIsValid()
+
+	if itr.cacheBeforeParent() {
+		return []byte(itr.cacheKeys[itr.cur])
+	}
+	return itr.parent.Key()
+}
+
+func (itr *cacheMergeIterator) Value() []byte {
+	itr.assertIsValid()
+
+	if itr.cacheBeforeParent() {
+		return itr.cache[itr.cacheKeys[itr.cur]].value
+	}
+	return itr.parent.Value()
+}
+
+func (itr *cacheMergeIterator) Close() {
+	itr.parent.Close()
+	itr.cacheKeys = nil
+	itr.cache = nil
+}
+
+func (itr *cacheMergeIterator) assertIsValid() {
+	if !itr.Valid() {
+		panic("cacheMergeIterator is invalid")
+	}
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCacheDBDeleteThenIterate(t *testing.T) {
+	parent := NewMemDB()
+	parent.Set([]byte("a"), []byte("1"))
+	parent.Set([]byte("b"), []byte("2"))
+	parent.Set([]byte("c"), []byte("3"))
+
+	cache := NewCacheDB(parent)
+	cache.Delete([]byte("b"))
+
+	if cache.Has([]byte("b")) {
+		t.Fatalf("cache.Has(b) = true after Delete, want false")
+	}
+
+	var got []string
+	itr := cache.Iterator(nil, nil)
+	for ; itr.Valid(); itr.Next() {
+		got = append(got, string(itr.Key()))
+	}
+	itr.Close()
+
+	want := []string{"a", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("Iterator() = %v, want %v (tombstoned key leaked through)", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Iterator() = %v, want %v (tombstoned key leaked through)", got, want)
+		}
+	}
+}
+
+// TestCacheDBCloseDoesNotCloseParent guards against CacheDB.Close()
+// cascading into the parent: a transient CacheDB wrapper must be
+// disposable without tearing down a parent shared by other wrappers.
+func TestCacheDBCloseDoesNotCloseParent(t *testing.T) {
+	parent := NewMemDB()
+	parent.Set([]byte("a"), []byte("1"))
+
+	cache := NewCacheDB(parent)
+	cache.Close()
+
+	if v := string(parent.Get([]byte("a"))); v != "1" {
+		t.Fatalf("parent.Get(a) = %q after CacheDB.Close(), want %q (parent was closed)", v, "1")
+	}
+	parent.Set([]byte("b"), []byte("2"))
+	if v := string(parent.Get([]byte("b"))); v != "2" {
+		t.Fatalf("parent.Get(b) = %q after CacheDB.Close(), want %q (parent unusable)", v, "2")
+	}
+}
+
+func TestCacheDBWriteFlushesAndClearsCache(t *testing.T) {
+	parent := NewMemDB()
+	parent.Set([]byte("a"), []byte("1"))
+
+	cache := NewCacheDB(parent)
+	cache.Set([]byte("b"), []byte("2"))
+	cache.Delete([]byte("a"))
+
+	if err := cache.Write(); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if len(cache.cache) != 0 {
+		t.Fatalf("cache not cleared after Write(), len = %d", len(cache.cache))
+	}
+	if parent.Has([]byte("a")) {
+		t.Fatalf("parent still has deleted key a after Write()")
+	}
+	if v := string(parent.Get([]byte("b"))); v != "2" {
+		t.Fatalf("parent.Get(b) = %q after Write(), want %q", v, "2")
+	}
+}
+
+// TestCacheDBIteratorStableDuringWrites guards against the iterator
+// aliasing the live c.cache map: once an Iterator is taken, concurrent
+// Set/Delete calls on the same CacheDB must not be visible through it
+// (and, under -race, must not race on the map at all).
+func TestCacheDBIteratorStableDuringWrites(t *testing.T) {
+	parent := NewMemDB()
+	parent.Set([]byte("a"), []byte("1"))
+
+	cache := NewCacheDB(parent)
+	cache.Set([]byte("b"), []byte("2"))
+
+	itr := cache.Iterator(nil, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cache.Set([]byte("c"), []byte("3"))
+			cache.Delete([]byte("b"))
+		}
+	}()
+
+	var got []string
+	for ; itr.Valid(); itr.Next() {
+		got = append(got, string(itr.Key()))
+	}
+	itr.Close()
+	wg.Wait()
+
+	want := []string{"a", "b"}
+	if len(got) != len(want) {
+		t.Fatalf("Iterator observed concurrent writes: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Iterator observed concurrent writes: got %v, want %v", got, want)
+		}
+	}
+}
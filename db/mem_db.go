@@ -1,27 +1,63 @@
 package db
 
 import (
+	"bytes"
 	"fmt"
-	"sort"
 	"sync"
+
+	"github.com/google/btree"
 )
 
+// bTreeDegree is the branching factor used for the underlying ordered
+// index. 32 is a reasonable default that keeps tree height low without
+// making node rebalancing too expensive.
+const bTreeDegree = 32
+
 func init() {
 	registerDBCreator(MemDBBackendStr, func(name string, dir string) (DB, error) {
-		return NewMemDB(), nil
+		if dir == "" {
+			return NewMemDB(), nil
+		}
+		return NewMemDBWithDir(dir, name)
 	}, false)
 }
 
 var _ DB = (*MemDB)(nil)
 
+// MemDB is an in-memory database backed by a B-tree. Unlike the previous
+// map+sort implementation, keys are kept in an ordered index at all times,
+// so Iterator/ReverseIterator can seek directly to a bound instead of
+// sorting the whole keyspace on every call.
+//
+// MemDB can optionally be opened against a directory (see
+// NewMemDBWithDir), in which case SetSync/DeleteSync durably append to a
+// write-ahead log so the in-memory state can be replayed on the next
+// open. Without a directory, MemDB is purely in-memory, as before.
 type MemDB struct {
 	mtx sync.Mutex
-	db  map[string][]byte
+	bt  *btree.BTree
+	wal *memDBWAL
+}
+
+// item is the value stored in the B-tree. It is ordered by key only;
+// value is carried along so lookups and iteration don't need a second
+// structure.
+type item struct {
+	key   []byte
+	value []byte
+}
+
+func (i *item) Less(than btree.Item) bool {
+	return bytes.Compare(i.key, than.(*item).key) == -1
+}
+
+func newKey(key []byte) *item {
+	return &item{key: key}
 }
 
 func NewMemDB() *MemDB {
 	database := &MemDB{
-		db: make(map[string][]byte),
+		bt: btree.New(bTreeDegree),
 	}
 	return database
 }
@@ -30,8 +66,12 @@ func (db *MemDB) Get(key []byte) []byte {
 	db.mtx.Lock()
 	defer db.mtx.Unlock()
 	key = nonNilBytes(key)
-  
-	return db.db[string(key)]
+
+	i := db.bt.Get(newKey(key))
+	if i == nil {
+		return nil
+	}
+	return i.(*item).value
 }
 
 func (db *MemDB) Has(key []byte) bool {
@@ -39,8 +79,7 @@ func (db *MemDB) Has(key []byte) bool {
 	defer db.mtx.Unlock()
 	key = nonNilBytes(key)
 
-	_, ok := db.db[string(key)]
-	return ok
+	return db.bt.Has(newKey(key))
 }
 
 func (db *MemDB) Set(key []byte, value []byte) {
@@ -55,6 +94,12 @@ func (db *MemDB) SetSync(key []byte, value []byte) {
 	defer db.mtx.Unlock()
 
 	db.SetNoLock(key, value)
+
+	if db.wal != nil {
+		if err := db.wal.sync(); err != nil {
+			panic(fmt.Sprintf("memDB: failed to fsync WAL: %v", err))
+		}
+	}
 }
 
 // NOTE: Implements atomicSetDeleter
@@ -62,7 +107,16 @@ func (db *MemDB) SetNoLock(key []byte, value []byte) {
 	key = nonNilBytes(key)
 	value = nonNilBytes(value)
 
-	db.db[string(key)] = value
+	db.bt.ReplaceOrInsert(&item{key: key, value: value})
+
+	if db.wal != nil {
+		if err := db.wal.writeSet(key, value); err != nil {
+			panic(fmt.Sprintf("memDB: failed to append to WAL: %v", err))
+		}
+		if err := db.compact(); err != nil {
+			panic(fmt.Sprintf("memDB: failed to compact WAL: %v", err))
+		}
+	}
 }
 
 func (db *MemDB) Delete(key []byte) {
@@ -77,30 +131,55 @@ func (db *MemDB) DeleteSync(key []byte) {
 	defer db.mtx.Unlock()
 
 	db.DeleteNoLock(key)
+
+	if db.wal != nil {
+		if err := db.wal.sync(); err != nil {
+			panic(fmt.Sprintf("memDB: failed to fsync WAL: %v", err))
+		}
+	}
 }
 
 // NOTE: Implements atomicSetDeleter
 func (db *MemDB) DeleteNoLock(key []byte) {
 	key = nonNilBytes(key)
 
-	delete(db.db, string(key))
+	db.bt.Delete(newKey(key))
+
+	if db.wal != nil {
+		if err := db.wal.writeDelete(key); err != nil {
+			panic(fmt.Sprintf("memDB: failed to append to WAL: %v", err))
+		}
+		if err := db.compact(); err != nil {
+			panic(fmt.Sprintf("memDB: failed to compact WAL: %v", err))
+		}
+	}
 }
 
 func (db *MemDB) Close() {
-	// Close is a noop since for an in-memory
-	// database, we don't have a destination
-	// to flush contents to nor do we want
-	// any data loss on invoking Close()
-	// See the discussion in https://github.com/tendermint/tmlibs/pull/56
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	// Without a WAL, Close is a noop since for an in-memory database, we
+	// don't have a destination to flush contents to nor do we want any
+	// data loss on invoking Close(). See the discussion in
+	// https://github.com/tendermint/tmlibs/pull/56
+	if db.wal == nil {
+		return
+	}
+	if err := db.wal.close(); err != nil {
+		panic(fmt.Sprintf("memDB: failed to close WAL: %v", err))
+	}
 }
 
 func (db *MemDB) Print() {
 	db.mtx.Lock()
 	defer db.mtx.Unlock()
 
-	for key, value := range db.db {
-		fmt.Printf("[%X]:\t[%X]\n", []byte(key), value)
-	}
+	db.bt.Ascend(func(i btree.Item) bool {
+		it := i.(*item)
+		fmt.Printf("[%X]:\t[%X]\n", it.key, it.value)
+		return true
+	})
 }
 
 func (db *MemDB) Stats() map[string]string {
@@ -109,7 +188,7 @@ func (db *MemDB) Stats() map[string]string {
 
 	stats := make(map[string]string)
 	stats["database.type"] = "memDB"
-	stats["database.size"] = fmt.Sprintf("%d", len(db.db))
+	stats["database.size"] = fmt.Sprintf("%d", db.bt.Len())
 	return stats
 }
 
@@ -126,60 +205,113 @@ func (db *MemDB) Mutex() *sync.Mutex {
 
 //----------------------------------------
 
+// Iterator and ReverseIterator walk a Clone()d snapshot of the tree,
+// not the live db.bt, so a concurrent Set/Delete on db never races with
+// (or is even visible to) an in-flight iteration. Clone() is an O(1)
+// copy-on-write split, the same mechanism Snapshot() uses, so this adds
+// no meaningful cost over locking for the duration of the iteration.
 func (db *MemDB) Iterator(start, end []byte) Iterator {
 	db.mtx.Lock()
 	defer db.mtx.Unlock()
 
-	keys := db.getSortedKeys(start, end, false)
-	return newMemDBIterator(db, keys, start, end)
+	return newMemDBIterator(db.bt.Clone(), start, end, false)
 }
 
 func (db *MemDB) ReverseIterator(start, end []byte) Iterator {
 	db.mtx.Lock()
 	defer db.mtx.Unlock()
 
-	keys := db.getSortedKeys(end, start, true)
-	return newMemDBIterator(db, keys, start, end)
+	return newMemDBIterator(db.bt.Clone(), start, end, true)
 }
 
-func (db *MemDB) getSortedKeys(start, end []byte, reverse bool) []string {
-	keys := []string{}
-	for key, _ := range db.db {
-		if IsKeyInDomain([]byte(key), start, end, false) {
-			keys = append(keys, key)
-		}
+var _ Iterator = (*memDBIterator)(nil)
+
+// memDBIterator walks a B-tree directly instead of materializing a
+// sorted key slice. It seeks to start/end in O(log N) and then advances
+// one node at a time, so callers that only read a handful of entries
+// don't pay for the full domain. It is also used by MemDBSnapshot, which
+// hands it a cloned, frozen tree.
+type memDBIterator struct {
+	bt      *btree.BTree
+	reverse bool
+	start   []byte
+	end     []byte
+
+	item *item
+	done bool
+}
+
+func newMemDBIterator(bt *btree.BTree, start, end []byte, reverse bool) *memDBIterator {
+	itr := &memDBIterator{
+		bt:      bt,
+		reverse: reverse,
+		start:   start,
+		end:     end,
 	}
-	sort.Strings(keys)
-	if reverse {
-		nkeys := len(keys)
-		for i := 0; i < nkeys/2; i++ {
-			keys[i] = keys[nkeys-i-1]
+	itr.seekFirst()
+	return itr
+}
+
+func (itr *memDBIterator) seekFirst() {
+	var first *item
+	visit := func(i btree.Item) bool {
+		first = i.(*item)
+		return false
+	}
+	if !itr.reverse {
+		if itr.start == nil {
+			itr.bt.Ascend(visit)
+		} else {
+			itr.bt.AscendGreaterOrEqual(newKey(itr.start), visit)
+		}
+	} else {
+		if itr.end == nil {
+			itr.bt.Descend(visit)
+		} else {
+			itr.bt.DescendLessOrEqual(newKey(itr.end), visit)
 		}
 	}
-	return keys
+	itr.item = first
+	itr.advanceToValid()
 }
 
-var _ Iterator = (*memDBIterator)(nil)
+// advanceToValid skips forward (or backward) past any item outside the
+// domain, and marks the iterator done once it passes the bound or runs
+// out of entries. ReverseIterator's upper bound (end) is exclusive, just
+// like Iterator's, so a DescendLessOrEqual seek on end may need one step
+// to skip past end itself.
+func (itr *memDBIterator) advanceToValid() {
+	for itr.item != nil {
+		if !IsKeyInDomain(itr.item.key, itr.start, itr.end, false) {
+			if itr.reverse && itr.end != nil && bytes.Equal(itr.item.key, itr.end) {
+				itr.stepInternal()
+				continue
+			}
+			itr.item = nil
+			break
+		}
+		break
+	}
+	itr.done = itr.item == nil
+}
 
-// We need a copy of all of the keys.
-// Not the best, but probably not a bottleneck depending.
-type memDBIterator struct {
-	db    DB
-	cur   int
-	keys  []string
-	start []byte
-	end   []byte
-}
-
-// Keys is expected to be in reverse order for reverse iterators.
-func newMemDBIterator(db DB, keys []string, start, end []byte) *memDBIterator {
-	return &memDBIterator{
-		db:    db,
-		cur:   0,
-		keys:  keys,
-		start: start,
-		end:   end,
+func (itr *memDBIterator) stepInternal() {
+	cur := itr.item
+	var next *item
+	visit := func(i btree.Item) bool {
+		it := i.(*item)
+		if bytes.Equal(it.key, cur.key) {
+			return true
+		}
+		next = it
+		return false
+	}
+	if !itr.reverse {
+		itr.bt.AscendGreaterOrEqual(newKey(cur.key), visit)
+	} else {
+		itr.bt.DescendLessOrEqual(newKey(cur.key), visit)
 	}
+	itr.item = next
 }
 
 func (itr *memDBIterator) Domain() ([]byte, []byte) {
@@ -187,32 +319,32 @@ func (itr *memDBIterator) Domain() ([]byte, []byte) {
 }
 
 func (itr *memDBIterator) Valid() bool {
-	return 0 <= itr.cur && itr.cur < len(itr.keys)
+	return !itr.done && itr.item != nil
 }
 
 func (itr *memDBIterator) Next() {
 	itr.assertIsValid()
-	itr.cur++
+	itr.stepInternal()
+	itr.advanceToValid()
 }
 
 func (itr *memDBIterator) Key() []byte {
 	itr.assertIsValid()
-	return []byte(itr.keys[itr.cur])
+	return itr.item.key
 }
 
 func (itr *memDBIterator) Value() []byte {
 	itr.assertIsValid()
-	key := []byte(itr.keys[itr.cur])
-	return itr.db.Get(key)
+	return itr.item.value
 }
 
 func (itr *memDBIterator) Close() {
-	itr.keys = nil
-	itr.db = nil
+	itr.item = nil
+	itr.bt = nil
 }
 
 func (itr *memDBIterator) assertIsValid() {
 	if !itr.Valid() {
 		panic("memDBIterator is invalid")
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"github.com/google/btree"
+)
+
+// Snapshot returns an immutable, point-in-time view of db. Because the
+// underlying index is a copy-on-write B-tree, Clone() is O(1): the
+// snapshot and the live db start out sharing every node, and only the
+// nodes touched by subsequent writes to db get copied. Writes made to db
+// after Snapshot() returns are never visible through the snapshot.
+//
+// This lets a consumer (state sync, IAVL, mempool re-checks, ...) hold a
+// stable view and iterate it at its own pace while db keeps accepting
+// writes concurrently.
+func (db *MemDB) Snapshot() *MemDBSnapshot {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	return &MemDBSnapshot{bt: db.bt.Clone()}
+}
+
+// MemDBSnapshot is a read-only, frozen view over a MemDB as of the
+// moment Snapshot() was called. It satisfies the read-only subset of the
+// DB interface; there is no Set/Delete/NewBatch, since a snapshot can
+// never be mutated.
+type MemDBSnapshot struct {
+	bt *btree.BTree
+}
+
+func (s *MemDBSnapshot) Get(key []byte) []byte {
+	key = nonNilBytes(key)
+
+	i := s.bt.Get(newKey(key))
+	if i == nil {
+		return nil
+	}
+	return i.(*item).value
+}
+
+func (s *MemDBSnapshot) Has(key []byte) bool {
+	key = nonNilBytes(key)
+
+	return s.bt.Has(newKey(key))
+}
+
+func (s *MemDBSnapshot) Iterator(start, end []byte) Iterator {
+	return newMemDBIterator(s.bt, start, end, false)
+}
+
+func (s *MemDBSnapshot) ReverseIterator(start, end []byte) Iterator {
+	return newMemDBIterator(s.bt, start, end, true)
+}
+
+// Discard releases the snapshot's reference to its tree. It is not
+// required for correctness (the COW tree is garbage collected like any
+// other value), but lets long-lived callers free the reference
+// explicitly once they're done iterating.
+func (s *MemDBSnapshot) Discard() {
+	s.bt = nil
+}
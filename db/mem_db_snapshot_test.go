@@ -0,0 +1,34 @@
+package db
+
+import "testing"
+
+func TestMemDBSnapshotIsolation(t *testing.T) {
+	db := NewMemDB()
+	db.Set([]byte("a"), []byte("1"))
+
+	snap := db.Snapshot()
+
+	db.Set([]byte("a"), []byte("2"))
+	db.Set([]byte("b"), []byte("3"))
+
+	if v := string(snap.Get([]byte("a"))); v != "1" {
+		t.Fatalf("snapshot.Get(a) = %q, want %q", v, "1")
+	}
+	if snap.Has([]byte("b")) {
+		t.Fatalf("snapshot.Has(b) = true, want false")
+	}
+	if v := string(db.Get([]byte("a"))); v != "2" {
+		t.Fatalf("db.Get(a) = %q, want %q", v, "2")
+	}
+
+	var got []string
+	itr := snap.Iterator(nil, nil)
+	for ; itr.Valid(); itr.Next() {
+		got = append(got, string(itr.Key()))
+	}
+	itr.Close()
+
+	if len(got) != 1 || got[0] != "a" {
+		t.Fatalf("snap.Iterator() = %v, want [a]", got)
+	}
+}
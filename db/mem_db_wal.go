@@ -0,0 +1,247 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/btree"
+)
+
+// walCompactionThreshold is the log size, in bytes, above which the WAL
+// is rewritten from the current in-memory state instead of keeping every
+// historical mutation around forever.
+const walCompactionThreshold = 16 * 1024 * 1024 // 16MB
+
+const (
+	walOpSet    byte = 1
+	walOpDelete byte = 2
+)
+
+// memDBWAL is an append-only log of MemDB mutations, used to recover
+// MemDB's in-memory state after a restart. It is purely additive: it
+// never changes Get/Set/Delete semantics, only what NewMemDBWithDir does
+// before handing back a ready-to-use MemDB.
+type memDBWAL struct {
+	path string
+	file *os.File
+	size int64
+}
+
+// NewMemDBWithDir opens (or creates) a MemDB whose mutations are durably
+// recorded to a write-ahead log under dir, and whose contents are
+// recovered by replaying that log. name is used to pick the log file
+// name so multiple MemDB-backed stores can share a directory the way
+// other backends do.
+func NewMemDBWithDir(dir string, name string) (*MemDB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("memDB: failed to create dir %q: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, name+".wal")
+	database := &MemDB{bt: btree.New(bTreeDegree)}
+
+	if err := database.replayWAL(path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("memDB: failed to open WAL %q: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("memDB: failed to stat WAL %q: %w", path, err)
+	}
+
+	database.wal = &memDBWAL{path: path, file: f, size: info.Size()}
+	return database, nil
+}
+
+// replayWAL rebuilds db's in-memory tree from an existing log file, if
+// one is present. A missing file just means this is the first open.
+//
+// Non-Sync writes are fsync-free by design, so a crash right after one
+// routinely leaves a torn trailing record (a header or value cut off
+// mid-write). That is expected, not corruption: replay stops at the
+// first torn record and truncates it away, on the same reasoning as a
+// write that never reached durable storage in the first place. Only a
+// read error in the *middle* of the log (a record other than the last)
+// indicates real corruption and is still reported.
+func (db *MemDB) replayWAL(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("memDB: failed to open WAL %q for replay: %w", path, err)
+	}
+	defer f.Close()
+
+	r := &walReader{r: f}
+	var offset int64
+	for {
+		op, key, value, n, err := r.readRecord()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				if truncErr := f.Truncate(offset); truncErr != nil {
+					return fmt.Errorf("memDB: failed to truncate torn WAL %q: %w", path, truncErr)
+				}
+				break
+			}
+			return fmt.Errorf("memDB: failed to replay WAL %q: %w", path, err)
+		}
+		offset += int64(n)
+		switch op {
+		case walOpSet:
+			db.bt.ReplaceOrInsert(&item{key: key, value: value})
+		case walOpDelete:
+			db.bt.Delete(newKey(key))
+		}
+	}
+	return nil
+}
+
+func (w *memDBWAL) writeSet(key, value []byte) error {
+	return w.writeRecord(walOpSet, key, value)
+}
+
+func (w *memDBWAL) writeDelete(key []byte) error {
+	return w.writeRecord(walOpDelete, key, nil)
+}
+
+func (w *memDBWAL) writeRecord(op byte, key, value []byte) error {
+	n, err := writeRecord(w.file, op, key, value)
+	w.size += int64(n)
+	return err
+}
+
+func (w *memDBWAL) sync() error {
+	return w.file.Sync()
+}
+
+func (w *memDBWAL) close() error {
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// compact rewrites the WAL from db's current tree, dropping the history
+// of intermediate mutations, once the log has grown past
+// walCompactionThreshold. It is called with db.mtx already held.
+func (db *MemDB) compact() error {
+	w := db.wal
+	if w == nil || w.size < walCompactionThreshold {
+		return nil
+	}
+
+	tmpPath := w.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("memDB: failed to create compaction file %q: %w", tmpPath, err)
+	}
+
+	var size int64
+	var writeErr error
+	db.bt.Ascend(func(i btree.Item) bool {
+		it := i.(*item)
+		var n int
+		n, writeErr = writeRecord(tmp, walOpSet, it.key, it.value)
+		size += int64(n)
+		return writeErr == nil
+	})
+	if writeErr != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("memDB: failed to write compaction file %q: %w", tmpPath, writeErr)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return fmt.Errorf("memDB: failed to install compacted WAL %q: %w", w.path, err)
+	}
+
+	f, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("memDB: failed to reopen compacted WAL %q: %w", w.path, err)
+	}
+	w.file = f
+	w.size = size
+	return nil
+}
+
+//----------------------------------------
+// record encoding: op(1) | keyLen(4) | valueLen(4) | key | value
+
+func writeRecord(w io.Writer, op byte, key, value []byte) (int, error) {
+	var header [9]byte
+	header[0] = op
+	binary.BigEndian.PutUint32(header[1:5], uint32(len(key)))
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(value)))
+
+	n, err := w.Write(header[:])
+	if err != nil {
+		return n, err
+	}
+	nk, err := w.Write(key)
+	n += nk
+	if err != nil {
+		return n, err
+	}
+	nv, err := w.Write(value)
+	n += nv
+	return n, err
+}
+
+type walReader struct {
+	r io.Reader
+}
+
+// readRecord returns the record read, along with n, the total number of
+// bytes it spans in the log. n is only meaningful on success; callers
+// use it to know where to truncate a torn trailing record.
+func (r *walReader) readRecord() (op byte, key, value []byte, n int, err error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return 0, nil, nil, 0, err
+	}
+	op = header[0]
+	keyLen := binary.BigEndian.Uint32(header[1:5])
+	valueLen := binary.BigEndian.Uint32(header[5:9])
+
+	// Once the header is read, running out of bytes means a torn record,
+	// even if the cut fell exactly on the header/key boundary.
+	key = make([]byte, keyLen)
+	if _, err := io.ReadFull(r.r, key); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil, 0, err
+	}
+	value = make([]byte, valueLen)
+	if _, err := io.ReadFull(r.r, value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, nil, 0, err
+	}
+	return op, key, value, len(header) + len(key) + len(value), nil
+}